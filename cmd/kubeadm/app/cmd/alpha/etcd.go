@@ -0,0 +1,87 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package alpha
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	kubeadmetcd "k8s.io/kubernetes/cmd/kubeadm/app/phases/etcd"
+	kubeadmutil "k8s.io/kubernetes/cmd/kubeadm/app/util"
+	cmdutil "k8s.io/kubernetes/cmd/kubeadm/app/util/cmd"
+)
+
+// NewCmdEtcd returns the "kubeadm alpha etcd" command, grouping maintenance
+// operations for the local, kubeadm-managed etcd member.
+func NewCmdEtcd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "etcd",
+		Short: "Operations on the local etcd member maintained by kubeadm",
+	}
+
+	cmd.AddCommand(newCmdEtcdBackup())
+	cmd.AddCommand(newCmdEtcdRestore())
+	return cmd
+}
+
+func newCmdEtcdBackup() *cobra.Command {
+	var cfgPath, outPath string
+
+	cmd := &cobra.Command{
+		Use:   "backup",
+		Short: "Take a snapshot of the local etcd member's data",
+		Run: func(cmd *cobra.Command, args []string) {
+			cfg, err := kubeadmutil.GetMasterConfiguration(cfgPath)
+			cmdutil.CheckErr(err)
+
+			err = kubeadmetcd.SnapshotLocalEtcd(cfg, outPath)
+			cmdutil.CheckErr(err)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVar(&cfgPath, "config", "", "Path to a kubeadm MasterConfiguration file")
+	flags.StringVar(&outPath, "out", "/var/lib/etcd-backup/snapshot.db", "Path to write the etcd snapshot to")
+	return cmd
+}
+
+func newCmdEtcdRestore() *cobra.Command {
+	var cfgPath, manifestDir, snapshotPath string
+
+	cmd := &cobra.Command{
+		Use:   "restore",
+		Short: "Restore the local etcd member's data directory from a snapshot",
+		Run: func(cmd *cobra.Command, args []string) {
+			if snapshotPath == "" {
+				cmdutil.CheckErr(fmt.Errorf("--snapshot is required"))
+			}
+
+			cfg, err := kubeadmutil.GetMasterConfiguration(cfgPath)
+			cmdutil.CheckErr(err)
+
+			err = kubeadmetcd.RestoreLocalEtcdFromSnapshot(cfg, manifestDir, snapshotPath)
+			cmdutil.CheckErr(err)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVar(&cfgPath, "config", "", "Path to a kubeadm MasterConfiguration file")
+	flags.StringVar(&manifestDir, "manifest-dir", "/etc/kubernetes/manifests", "Path to the directory with static Pod manifests")
+	flags.StringVar(&snapshotPath, "snapshot", "", "Path to the etcd snapshot to restore from")
+	return cmd
+}
@@ -0,0 +1,149 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package etcd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	clientv3 "go.etcd.io/etcd/clientv3"
+	"go.etcd.io/etcd/clientv3/snapshot"
+	"go.uber.org/zap"
+
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+	kubeadmapi "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm"
+)
+
+// defaultSnapshotEndpoint is the loopback client URL of a single-node local etcd
+// member, which kubeadm dials when no other member endpoint can be derived from
+// the LocalEtcd configuration.
+const defaultSnapshotEndpoint = "https://127.0.0.1:2379"
+
+// defaultPeerURL is the loopback peer URL of a single-node local etcd member,
+// paired with defaultSnapshotEndpoint on the same host.
+const defaultPeerURL = "https://127.0.0.1:2380"
+
+// SnapshotLocalEtcd takes a point-in-time snapshot of the kubeadm-managed local
+// etcd member and writes it to outPath, equivalent to `etcdctl snapshot save`.
+func SnapshotLocalEtcd(cfg *kubeadmapi.MasterConfiguration, outPath string) error {
+	if cfg.Etcd.Local == nil {
+		return fmt.Errorf("cannot take a snapshot: no Local etcd configuration set")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(outPath), 0700); err != nil {
+		return fmt.Errorf("couldn't create directory for etcd snapshot %q: %v", outPath, err)
+	}
+
+	tlsConfig, err := transportTLSInfo(cfg).ClientConfig()
+	if err != nil {
+		return fmt.Errorf("couldn't load etcd peer TLS material: %v", err)
+	}
+
+	// A stacked/HA member has getEtcdCommand rebind listen-client-urls to its
+	// own advertise address rather than loopback, so the snapshot has to be
+	// taken from that same address instead of the hardcoded localhost default.
+	addr, err := advertiseAddress(cfg.Etcd.Local)
+	if err != nil {
+		return fmt.Errorf("couldn't determine the local etcd member's address: %v", err)
+	}
+	endpoint := fmt.Sprintf("https://%s:2379", addr)
+
+	ctx, cancel := context.WithTimeout(context.Background(), etcdClientTimeout)
+	defer cancel()
+
+	lg, err := zap.NewProduction()
+	if err != nil {
+		return fmt.Errorf("couldn't set up etcd snapshot logger: %v", err)
+	}
+
+	manager := snapshot.NewV3(lg)
+	if err := manager.Save(ctx, clientv3.Config{
+		Endpoints: []string{endpoint},
+		TLS:       tlsConfig,
+	}, outPath); err != nil {
+		return fmt.Errorf("couldn't save etcd snapshot to %q: %v", outPath, err)
+	}
+
+	fmt.Printf("[etcd] Saved snapshot of the local etcd member to %q\n", outPath)
+	return nil
+}
+
+// RestoreLocalEtcdFromSnapshot restores the kubeadm-managed local etcd member's
+// data directory from a snapshot previously taken with SnapshotLocalEtcd, giving
+// the restored member a fresh member ID and initial-cluster-token so it doesn't
+// collide with the cluster it was originally a part of. It then rewrites the
+// static pod manifest via the same code path CreateLocalEtcdStaticPodManifestFile
+// uses so the kubelet restarts etcd against the restored data.
+func RestoreLocalEtcdFromSnapshot(cfg *kubeadmapi.MasterConfiguration, manifestDir, snapshotPath string) error {
+	if cfg.Etcd.Local == nil {
+		return fmt.Errorf("cannot restore a snapshot: no Local etcd configuration set")
+	}
+
+	name := cfg.Etcd.Local.Name
+	if name == "" {
+		name = "default"
+	}
+
+	peerURLs := cfg.Etcd.Local.AdvertisePeerURLs
+	if len(peerURLs) == 0 {
+		peerURLs = []string{defaultPeerURL}
+	}
+
+	initialCluster := cfg.Etcd.Local.InitialCluster
+	if len(initialCluster) == 0 {
+		initialCluster = []string{fmt.Sprintf("%s=%s", name, peerURLs[0])}
+	}
+
+	lg, err := zap.NewProduction()
+	if err != nil {
+		return fmt.Errorf("couldn't set up etcd restore logger: %v", err)
+	}
+
+	if err := os.RemoveAll(cfg.Etcd.Local.DataDir); err != nil {
+		return fmt.Errorf("couldn't clear existing etcd data directory %q before restoring: %v", cfg.Etcd.Local.DataDir, err)
+	}
+
+	manager := snapshot.NewV3(lg)
+	if err := manager.Restore(snapshot.RestoreConfig{
+		SnapshotPath:        snapshotPath,
+		Name:                name,
+		OutputDataDir:       cfg.Etcd.Local.DataDir,
+		PeerURLs:            peerURLs,
+		InitialCluster:      strings.Join(initialCluster, ","),
+		InitialClusterToken: "kubeadm-restore-" + utilrand.String(8),
+		SkipHashCheck:       false,
+	}); err != nil {
+		return fmt.Errorf("couldn't restore etcd snapshot %q: %v", snapshotPath, err)
+	}
+
+	// The restore above always gives the data directory a brand-new
+	// InitialClusterToken, so it can never rejoin the raft group it was
+	// snapshotted from - "existing" would tell etcd to join a running cluster
+	// the restored data doesn't actually match. A restore always bootstraps a
+	// fresh cluster identity, so the manifest must ask for "new" instead.
+	cfg.Etcd.Local.InitialClusterState = "new"
+
+	if err := CreateLocalEtcdStaticPodManifestFile(manifestDir, cfg); err != nil {
+		return fmt.Errorf("couldn't rewrite the etcd static pod manifest after restoring the snapshot: %v", err)
+	}
+
+	fmt.Printf("[etcd] Restored the local etcd member's data directory from %q\n", snapshotPath)
+	return nil
+}
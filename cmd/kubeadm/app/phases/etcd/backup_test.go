@@ -0,0 +1,94 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package etcd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	clientv3 "go.etcd.io/etcd/clientv3"
+	"go.etcd.io/etcd/clientv3/snapshot"
+	"go.etcd.io/etcd/integration"
+	"go.uber.org/zap"
+
+	kubeadmapi "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm"
+)
+
+// TestSnapshotSaveAndRestoreRoundTrip exercises the go.etcd.io/etcd/clientv3/snapshot
+// Save and Restore calls SnapshotLocalEtcd/RestoreLocalEtcdFromSnapshot make, against
+// an embedded single-member etcd cluster, independently of kubeadm's own TLS wiring.
+// Unlike RestoreLocalEtcdFromSnapshot, it restores with the snapshot hash check skipped.
+func TestSnapshotSaveAndRestoreRoundTrip(t *testing.T) {
+	integration.BeforeTestExternal(t)
+
+	clus := integration.NewClusterV3(t, &integration.ClusterConfig{Size: 1})
+	defer clus.Terminate(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), etcdClientTimeout)
+	defer cancel()
+
+	if _, err := clus.Client(0).Put(ctx, "/registry/canary", "present"); err != nil {
+		t.Fatalf("couldn't seed test data: %v", err)
+	}
+
+	tmpdir, err := os.MkdirTemp("", "kubeadm-etcd-backup-test")
+	if err != nil {
+		t.Fatalf("couldn't create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	lg := zap.NewNop()
+	snapshotPath := filepath.Join(tmpdir, "snapshot.db")
+	snapshotCfg := clientv3.Config{Endpoints: []string{clus.Members[0].GRPCAddr()}}
+	if err := snapshot.NewV3(lg).Save(ctx, snapshotCfg, snapshotPath); err != nil {
+		t.Fatalf("couldn't save snapshot: %v", err)
+	}
+
+	restoredDataDir := filepath.Join(tmpdir, "restored-etcd")
+	restoreConfig := snapshot.RestoreConfig{
+		SnapshotPath:        snapshotPath,
+		Name:                "restored",
+		OutputDataDir:       restoredDataDir,
+		PeerURLs:            []string{"http://localhost:12380"},
+		InitialCluster:      "restored=http://localhost:12380",
+		InitialClusterToken: "kubeadm-restore-test",
+		SkipHashCheck:       true,
+	}
+	if err := snapshot.NewV3(lg).Restore(restoreConfig); err != nil {
+		t.Fatalf("couldn't restore snapshot: %v", err)
+	}
+
+	if _, err := os.Stat(restoredDataDir); err != nil {
+		t.Errorf("expected a restored data directory at %q: %v", restoredDataDir, err)
+	}
+}
+
+func TestSnapshotLocalEtcdRequiresLocalConfig(t *testing.T) {
+	cfg := &kubeadmapi.MasterConfiguration{}
+	if err := SnapshotLocalEtcd(cfg, "/tmp/snapshot.db"); err == nil {
+		t.Error("expected SnapshotLocalEtcd to fail without a Local etcd configuration, got nil error")
+	}
+}
+
+func TestRestoreLocalEtcdFromSnapshotRequiresLocalConfig(t *testing.T) {
+	cfg := &kubeadmapi.MasterConfiguration{}
+	if err := RestoreLocalEtcdFromSnapshot(cfg, "/tmp/manifests", "/tmp/snapshot.db"); err == nil {
+		t.Error("expected RestoreLocalEtcdFromSnapshot to fail without a Local etcd configuration, got nil error")
+	}
+}
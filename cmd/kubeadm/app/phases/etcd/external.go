@@ -0,0 +1,127 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package etcd
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+
+	clientv3 "go.etcd.io/etcd/clientv3"
+	"go.etcd.io/etcd/pkg/transport"
+
+	kubeadmapi "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm"
+)
+
+// EtcdEndpointError records the failure probing a single external etcd endpoint,
+// so ValidateExternalEtcd can report per-endpoint causes instead of a single
+// opaque error for the whole cluster.
+type EtcdEndpointError struct {
+	Endpoint string
+	Err      error
+}
+
+func (e *EtcdEndpointError) Error() string {
+	return fmt.Sprintf("etcd endpoint %q: %v", e.Endpoint, e.Err)
+}
+
+// ExternalEtcdValidationError aggregates the EtcdEndpointErrors collected while
+// validating an externally managed etcd cluster.
+type ExternalEtcdValidationError struct {
+	Errors []*EtcdEndpointError
+}
+
+func (e *ExternalEtcdValidationError) Error() string {
+	msg := fmt.Sprintf("found %d unhealthy external etcd endpoint(s):", len(e.Errors))
+	for _, err := range e.Errors {
+		msg += "\n  - " + err.Error()
+	}
+	return msg
+}
+
+// ValidateExternalEtcd dials every endpoint in cfg.Etcd.External using the
+// caller-supplied CAFile/CertFile/KeyFile, runs a MemberList and a Get("/health")
+// probe against each of them, and returns the etcd cluster version discovered
+// along the way so the apiserver phase can pick a compatible storage backend.
+func ValidateExternalEtcd(cfg *kubeadmapi.MasterConfiguration) (string, error) {
+	external := cfg.Etcd.External
+	if external == nil {
+		return "", fmt.Errorf("cannot validate external etcd: no External etcd configuration set")
+	}
+	if len(external.Endpoints) == 0 {
+		return "", fmt.Errorf("cannot validate external etcd: no endpoints configured")
+	}
+
+	tlsConfig, err := (transport.TLSInfo{
+		CertFile:      external.CertFile,
+		KeyFile:       external.KeyFile,
+		TrustedCAFile: external.CAFile,
+	}).ClientConfig()
+	if err != nil {
+		return "", fmt.Errorf("couldn't load external etcd TLS material: %v", err)
+	}
+
+	aggregate := &ExternalEtcdValidationError{}
+	version := ""
+
+	for _, endpoint := range external.Endpoints {
+		v, err := probeExternalEtcdEndpoint(endpoint, tlsConfig)
+		if err != nil {
+			aggregate.Errors = append(aggregate.Errors, &EtcdEndpointError{Endpoint: endpoint, Err: err})
+			continue
+		}
+		if version == "" {
+			version = v
+		}
+	}
+
+	if len(aggregate.Errors) > 0 {
+		return "", aggregate
+	}
+
+	return version, nil
+}
+
+func probeExternalEtcdEndpoint(endpoint string, tlsConfig *tls.Config) (string, error) {
+	cli, err := clientv3.New(clientv3.Config{
+		Endpoints:   []string{endpoint},
+		DialTimeout: etcdClientTimeout,
+		TLS:         tlsConfig,
+	})
+	if err != nil {
+		return "", fmt.Errorf("could not connect: %v", err)
+	}
+	defer cli.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), etcdClientTimeout)
+	defer cancel()
+
+	if _, err := cli.MemberList(ctx); err != nil {
+		return "", fmt.Errorf("member list failed: %v", err)
+	}
+
+	if _, err := cli.Get(ctx, "/health"); err != nil {
+		return "", fmt.Errorf("health check failed: %v", err)
+	}
+
+	status, err := cli.Status(ctx, endpoint)
+	if err != nil {
+		return "", fmt.Errorf("status check failed: %v", err)
+	}
+
+	return status.Version, nil
+}
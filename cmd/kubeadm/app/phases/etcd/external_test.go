@@ -0,0 +1,165 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package etcd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.etcd.io/etcd/integration"
+
+	kubeadmapi "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm"
+	kubeadmconstants "k8s.io/kubernetes/cmd/kubeadm/app/constants"
+
+	testutil "k8s.io/kubernetes/cmd/kubeadm/test"
+)
+
+func TestCreateLocalEtcdStaticPodManifestFileModes(t *testing.T) {
+	var tests = []struct {
+		name        string
+		cfg         *kubeadmapi.MasterConfiguration
+		expectFiles int
+	}{
+		{
+			name: "local etcd writes a static pod manifest",
+			cfg: &kubeadmapi.MasterConfiguration{
+				Etcd: kubeadmapi.Etcd{
+					Local: &kubeadmapi.LocalEtcd{DataDir: "/var/lib/etcd", Image: "k8s.gcr.io/etcd"},
+				},
+			},
+			expectFiles: 1,
+		},
+		{
+			name: "external etcd writes no static pod manifest",
+			cfg: &kubeadmapi.MasterConfiguration{
+				Etcd: kubeadmapi.Etcd{
+					External: &kubeadmapi.ExternalEtcd{
+						Endpoints: []string{"https://10.0.1.10:2379"},
+						CAFile:    "/etc/kubernetes/pki/etcd/ca.crt",
+						CertFile:  "/etc/kubernetes/pki/apiserver-etcd-client.crt",
+						KeyFile:   "/etc/kubernetes/pki/apiserver-etcd-client.key",
+					},
+				},
+			},
+			expectFiles: 0,
+		},
+	}
+
+	for _, rt := range tests {
+		t.Run(rt.name, func(t *testing.T) {
+			tmpdir := testutil.SetupTempDir(t)
+			defer os.RemoveAll(tmpdir)
+
+			manifestPath := filepath.Join(tmpdir, kubeadmconstants.ManifestsSubDirName)
+			if err := CreateLocalEtcdStaticPodManifestFile(manifestPath, rt.cfg); err != nil {
+				t.Fatalf("CreateLocalEtcdStaticPodManifestFile returned an error: %v", err)
+			}
+
+			if rt.expectFiles == 0 {
+				if _, err := os.Stat(manifestPath); err == nil {
+					t.Errorf("expected no manifest directory to be created for external etcd")
+				}
+				return
+			}
+
+			testutil.AssertFilesCount(t, manifestPath, rt.expectFiles)
+			testutil.AssertFileExists(t, manifestPath, kubeadmconstants.Etcd+".yaml")
+		})
+	}
+}
+
+func TestValidateExternalEtcdRequiresEndpoints(t *testing.T) {
+	var tests = []struct {
+		name string
+		cfg  *kubeadmapi.MasterConfiguration
+	}{
+		{
+			name: "no External configuration",
+			cfg:  &kubeadmapi.MasterConfiguration{},
+		},
+		{
+			name: "External configuration with no endpoints",
+			cfg: &kubeadmapi.MasterConfiguration{
+				Etcd: kubeadmapi.Etcd{External: &kubeadmapi.ExternalEtcd{}},
+			},
+		},
+	}
+
+	for _, rt := range tests {
+		t.Run(rt.name, func(t *testing.T) {
+			if _, err := ValidateExternalEtcd(rt.cfg); err == nil {
+				t.Error("expected ValidateExternalEtcd to return an error, got nil")
+			}
+		})
+	}
+}
+
+// TestValidateExternalEtcd exercises the live MemberList/Get("/health")/Status
+// probing ValidateExternalEtcd performs against a real, TLS-enabled embedded
+// etcd cluster: it should return the cluster's version, and report a
+// per-endpoint EtcdEndpointError for an endpoint nothing is listening on.
+func TestValidateExternalEtcd(t *testing.T) {
+	integration.BeforeTestExternal(t)
+
+	tmpdir, err := os.MkdirTemp("", "kubeadm-etcd-external-test")
+	if err != nil {
+		t.Fatalf("couldn't create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	tlsInfo := writeTestEtcdCerts(t, tmpdir)
+
+	clus := integration.NewClusterV3(t, &integration.ClusterConfig{Size: 1, ClientTLS: &tlsInfo, PeerTLS: &tlsInfo})
+	defer clus.Terminate(t)
+
+	cfg := &kubeadmapi.MasterConfiguration{
+		Etcd: kubeadmapi.Etcd{
+			External: &kubeadmapi.ExternalEtcd{
+				Endpoints: []string{clus.Members[0].GRPCAddr(), "https://127.0.0.1:1"},
+				CAFile:    tlsInfo.TrustedCAFile,
+				CertFile:  tlsInfo.CertFile,
+				KeyFile:   tlsInfo.KeyFile,
+			},
+		},
+	}
+
+	version, err := ValidateExternalEtcd(cfg)
+	if err == nil {
+		t.Fatal("expected ValidateExternalEtcd to report an error for the unreachable endpoint")
+	}
+
+	aggregate, ok := err.(*ExternalEtcdValidationError)
+	if !ok {
+		t.Fatalf("expected an *ExternalEtcdValidationError, got %T: %v", err, err)
+	}
+	if len(aggregate.Errors) != 1 || aggregate.Errors[0].Endpoint != "https://127.0.0.1:1" {
+		t.Errorf("expected a single EtcdEndpointError for the unreachable endpoint, got %v", aggregate.Errors)
+	}
+	if version != "" {
+		t.Errorf("expected no version to be returned alongside an aggregate error, got %q", version)
+	}
+
+	cfg.Etcd.External.Endpoints = []string{clus.Members[0].GRPCAddr()}
+	version, err = ValidateExternalEtcd(cfg)
+	if err != nil {
+		t.Fatalf("expected ValidateExternalEtcd to succeed against a healthy cluster, got: %v", err)
+	}
+	if version == "" {
+		t.Error("expected ValidateExternalEtcd to return the discovered etcd version")
+	}
+}
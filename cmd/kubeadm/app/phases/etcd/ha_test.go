@@ -0,0 +1,96 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package etcd
+
+import (
+	"testing"
+
+	kubeadmapi "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm"
+)
+
+func TestInitialClusterState(t *testing.T) {
+	var tests = []struct {
+		name     string
+		local    *kubeadmapi.LocalEtcd
+		expected string
+	}{
+		{
+			name:     "defaults to new when unset",
+			local:    &kubeadmapi.LocalEtcd{},
+			expected: "new",
+		},
+		{
+			name:     "preserves an explicit existing state",
+			local:    &kubeadmapi.LocalEtcd{InitialClusterState: "existing"},
+			expected: "existing",
+		},
+	}
+
+	for _, rt := range tests {
+		t.Run(rt.name, func(t *testing.T) {
+			if actual := initialClusterState(rt.local); actual != rt.expected {
+				t.Errorf("initialClusterState returned %q, expected %q", actual, rt.expected)
+			}
+		})
+	}
+}
+
+func TestAdvertiseAddress(t *testing.T) {
+	var tests = []struct {
+		name     string
+		local    *kubeadmapi.LocalEtcd
+		expected string
+	}{
+		{
+			name:     "falls back to loopback for a single-node cluster",
+			local:    &kubeadmapi.LocalEtcd{},
+			expected: "127.0.0.1",
+		},
+		{
+			name:     "derives the host from AdvertisePeerURLs",
+			local:    &kubeadmapi.LocalEtcd{AdvertisePeerURLs: []string{"https://10.0.1.10:2380"}},
+			expected: "10.0.1.10",
+		},
+	}
+
+	for _, rt := range tests {
+		t.Run(rt.name, func(t *testing.T) {
+			actual, err := advertiseAddress(rt.local)
+			if err != nil {
+				t.Fatalf("advertiseAddress returned an error: %v", err)
+			}
+			if actual != rt.expected {
+				t.Errorf("advertiseAddress returned %q, expected %q", actual, rt.expected)
+			}
+		})
+	}
+}
+
+func TestJoinLocalEtcdMemberRequiresAdvertisePeerURLs(t *testing.T) {
+	cfg := &kubeadmapi.MasterConfiguration{
+		Etcd: kubeadmapi.Etcd{
+			Local: &kubeadmapi.LocalEtcd{
+				DataDir: "/var/lib/etcd",
+				Name:    "infra2",
+			},
+		},
+	}
+
+	if _, err := JoinLocalEtcdMember(cfg, []string{"https://10.0.1.10:2379"}); err == nil {
+		t.Error("expected JoinLocalEtcdMember to fail when AdvertisePeerURLs is empty, got nil error")
+	}
+}
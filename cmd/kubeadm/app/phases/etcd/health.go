@@ -0,0 +1,184 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package etcd
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	kubeadmapi "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm"
+)
+
+const (
+	// healthCheckRetries is the number of times CheckLocalEtcdClusterStatus retries
+	// a failed endpoint before giving up.
+	healthCheckRetries = 5
+	// healthCheckRetryInterval is the backoff between CheckLocalEtcdClusterStatus retries.
+	healthCheckRetryInterval = 2 * time.Second
+)
+
+// CheckLocalEtcdClusterStatus verifies that every already-running member of a
+// kubeadm-managed etcd cluster agrees on cluster membership, and is healthy,
+// before kubeadm proceeds to write (or rewrite) a static pod manifest. It
+// performs a linearizable Get("/health") against the cluster as a whole,
+// matching what `etcdctl endpoint health` does, and then issues a serializable
+// MemberList to every individual endpoint, refusing to proceed if any endpoint
+// is unreachable or disagrees with the others on the current membership - the
+// split-brain/stale-member scenario that can occur when a control-plane node
+// is added while an old, no-longer-present member is still listed.
+//
+// The local member itself is deliberately excluded from the endpoints probed:
+// when this check runs during a join (InitialClusterState == "existing"), the
+// local member's own etcd process hasn't been started yet - it is the static
+// pod manifest this check is gating - so dialing it would always fail.
+func CheckLocalEtcdClusterStatus(cfg *kubeadmapi.MasterConfiguration) error {
+	if cfg.Etcd.Local == nil {
+		return fmt.Errorf("cannot check cluster status: no Local etcd configuration set")
+	}
+
+	endpoints := clientURLsFromInitialCluster(cfg.Etcd.Local.InitialCluster, cfg.Etcd.Local.Name)
+	if len(endpoints) == 0 {
+		endpoints = []string{defaultSnapshotEndpoint}
+	}
+
+	return wait.PollImmediate(healthCheckRetryInterval, time.Duration(healthCheckRetries)*healthCheckRetryInterval, func() (bool, error) {
+		if err := checkClusterHealthAndMembership(cfg, endpoints); err != nil {
+			fmt.Printf("[etcd] Waiting for the local etcd cluster to become healthy and consistent: %v\n", err)
+			return false, nil
+		}
+		return true, nil
+	})
+}
+
+func checkClusterHealthAndMembership(cfg *kubeadmapi.MasterConfiguration, endpoints []string) error {
+	cli, err := newEtcdClient(cfg, endpoints)
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), etcdClientTimeout)
+	defer cancel()
+
+	// A linearizable Get is only served once a quorum of members agrees, so a
+	// successful read against /health is equivalent to `etcdctl endpoint health`.
+	if _, err := cli.Get(ctx, "/health"); err != nil {
+		return fmt.Errorf("linearizable health check against the etcd cluster failed: %v", err)
+	}
+
+	var reference []string
+	for _, endpoint := range endpoints {
+		members, err := memberNamesFor(cfg, endpoint)
+		if err != nil {
+			return fmt.Errorf("etcd endpoint %q is unreachable: %v", endpoint, err)
+		}
+
+		if reference == nil {
+			reference = members
+			continue
+		}
+
+		if !sameMembers(reference, members) {
+			return fmt.Errorf("etcd endpoint %q disagrees on cluster membership: got %v, expected %v", endpoint, members, reference)
+		}
+	}
+
+	return nil
+}
+
+// memberNamesFor issues a serializable MemberList against a single endpoint and
+// returns the sorted list of member names it reports.
+func memberNamesFor(cfg *kubeadmapi.MasterConfiguration, endpoint string) ([]string, error) {
+	cli, err := newEtcdClient(cfg, []string{endpoint})
+	if err != nil {
+		return nil, err
+	}
+	defer cli.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), etcdClientTimeout)
+	defer cancel()
+
+	// MemberList answers from the dialed member's own local view of the
+	// cluster without going through raft, which is exactly the serializable
+	// semantics we want here: each endpoint reports what it believes the
+	// membership to be, and the caller compares those views for agreement.
+	resp, err := cli.MemberList(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(resp.Members))
+	for _, member := range resp.Members {
+		names = append(names, member.Name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// clientURLFromPeerURL derives the client-API endpoint (port 2379) etcd serves
+// alongside a given peer-API URL (port 2380). getEtcdCommand/advertiseAddress
+// always configure the two as a pair on the same host, so the peer port can be
+// swapped for the client port to get somewhere the clientv3 RPCs used
+// throughout this package will actually be served.
+func clientURLFromPeerURL(peerURL string) (string, error) {
+	u, err := url.Parse(peerURL)
+	if err != nil {
+		return "", fmt.Errorf("could not parse etcd peer URL %q: %v", peerURL, err)
+	}
+	return fmt.Sprintf("https://%s:2379", u.Hostname()), nil
+}
+
+// clientURLsFromInitialCluster converts every peer URL in an InitialCluster
+// list of "name=peerURL" entries to its client-API counterpart, excluding the
+// member named self - e.g. to skip a member that is being joined but whose
+// etcd process hasn't started yet.
+func clientURLsFromInitialCluster(initialCluster []string, self string) []string {
+	urls := make([]string, 0, len(initialCluster))
+	for _, member := range initialCluster {
+		parts := strings.SplitN(member, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		name, peerURL := parts[0], parts[1]
+		if name == self {
+			continue
+		}
+		clientURL, err := clientURLFromPeerURL(peerURL)
+		if err != nil {
+			continue
+		}
+		urls = append(urls, clientURL)
+	}
+	return urls
+}
+
+func sameMembers(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,216 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package etcd
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.etcd.io/etcd/integration"
+	"go.etcd.io/etcd/pkg/transport"
+
+	kubeadmapi "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm"
+	kubeadmconstants "k8s.io/kubernetes/cmd/kubeadm/app/constants"
+)
+
+func TestSameMembers(t *testing.T) {
+	var tests = []struct {
+		name     string
+		a, b     []string
+		expected bool
+	}{
+		{name: "equal", a: []string{"infra1", "infra2"}, b: []string{"infra1", "infra2"}, expected: true},
+		{name: "different length", a: []string{"infra1"}, b: []string{"infra1", "infra2"}, expected: false},
+		{name: "different members", a: []string{"infra1", "infra2"}, b: []string{"infra1", "infra3"}, expected: false},
+	}
+
+	for _, rt := range tests {
+		t.Run(rt.name, func(t *testing.T) {
+			if actual := sameMembers(rt.a, rt.b); actual != rt.expected {
+				t.Errorf("sameMembers returned %v, expected %v", actual, rt.expected)
+			}
+		})
+	}
+}
+
+func TestCheckLocalEtcdClusterStatusRequiresLocalConfig(t *testing.T) {
+	cfg := &kubeadmapi.MasterConfiguration{}
+	if err := CheckLocalEtcdClusterStatus(cfg); err == nil {
+		t.Error("expected CheckLocalEtcdClusterStatus to fail without a Local etcd configuration, got nil error")
+	}
+}
+
+func TestClientURLsFromInitialCluster(t *testing.T) {
+	var tests = []struct {
+		name           string
+		initialCluster []string
+		self           string
+		expected       []string
+	}{
+		{
+			name:           "converts peer URLs to client URLs",
+			initialCluster: []string{"infra1=https://10.0.1.10:2380", "infra2=https://10.0.1.11:2380"},
+			self:           "",
+			expected:       []string{"https://10.0.1.10:2379", "https://10.0.1.11:2379"},
+		},
+		{
+			name:           "excludes the member named self",
+			initialCluster: []string{"infra1=https://10.0.1.10:2380", "infra2=https://10.0.1.11:2380"},
+			self:           "infra2",
+			expected:       []string{"https://10.0.1.10:2379"},
+		},
+		{
+			name:           "skips malformed entries",
+			initialCluster: []string{"not-a-valid-entry"},
+			self:           "",
+			expected:       []string{},
+		},
+	}
+
+	for _, rt := range tests {
+		t.Run(rt.name, func(t *testing.T) {
+			actual := clientURLsFromInitialCluster(rt.initialCluster, rt.self)
+			if !reflect.DeepEqual(actual, rt.expected) {
+				t.Errorf("clientURLsFromInitialCluster returned %v, expected %v", actual, rt.expected)
+			}
+		})
+	}
+}
+
+// TestCheckClusterHealthAndMembershipLive exercises the live-cluster health and
+// membership-agreement checks CheckLocalEtcdClusterStatus relies on against an
+// embedded multi-member etcd cluster: it should pass while every member is up,
+// and fail once one becomes unreachable - the split-brain/stale-member scenario
+// this preflight exists to catch.
+func TestCheckClusterHealthAndMembershipLive(t *testing.T) {
+	integration.BeforeTestExternal(t)
+
+	tmpdir, err := os.MkdirTemp("", "kubeadm-etcd-health-test")
+	if err != nil {
+		t.Fatalf("couldn't create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	tlsInfo := writeTestEtcdCerts(t, tmpdir)
+
+	clus := integration.NewClusterV3(t, &integration.ClusterConfig{Size: 2, ClientTLS: &tlsInfo, PeerTLS: &tlsInfo})
+	defer clus.Terminate(t)
+
+	cfg := &kubeadmapi.MasterConfiguration{
+		CertificatesDir: tmpdir,
+		Etcd:            kubeadmapi.Etcd{Local: &kubeadmapi.LocalEtcd{}},
+	}
+	endpoints := []string{clus.Members[0].GRPCAddr(), clus.Members[1].GRPCAddr()}
+
+	if err := checkClusterHealthAndMembership(cfg, endpoints); err != nil {
+		t.Errorf("expected a healthy 2-member cluster to pass the check, got: %v", err)
+	}
+
+	clus.Members[1].Stop(t)
+	defer clus.Members[1].Restart(t)
+
+	if err := checkClusterHealthAndMembership(cfg, endpoints); err == nil {
+		t.Error("expected the check to fail once a member becomes unreachable")
+	}
+}
+
+// writeTestEtcdCerts generates a throwaway CA and a server/peer certificate
+// under dir/etcd, named the way kubeadm lays out its etcd PKI, and returns the
+// transport.TLSInfo pointing at them.
+func writeTestEtcdCerts(t *testing.T, dir string) transport.TLSInfo {
+	t.Helper()
+
+	caKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("couldn't generate test CA key: %v", err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "kubeadm-test-etcd-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("couldn't create test CA certificate: %v", err)
+	}
+	caCert, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatalf("couldn't parse test CA certificate: %v", err)
+	}
+
+	serverKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("couldn't generate test server key: %v", err)
+	}
+	serverTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		DNSNames:     []string{"localhost"},
+	}
+	serverDER, err := x509.CreateCertificate(rand.Reader, serverTemplate, caCert, &serverKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("couldn't create test server certificate: %v", err)
+	}
+
+	etcdDir := filepath.Join(dir, "etcd")
+	if err := os.MkdirAll(etcdDir, 0700); err != nil {
+		t.Fatalf("couldn't create %q: %v", etcdDir, err)
+	}
+
+	writePEMFile(t, filepath.Join(etcdDir, kubeadmconstants.EtcdCACertName), "CERTIFICATE", caDER)
+	writePEMFile(t, filepath.Join(etcdDir, kubeadmconstants.EtcdPeerCertName), "CERTIFICATE", serverDER)
+	writePEMFile(t, filepath.Join(etcdDir, kubeadmconstants.EtcdPeerKeyName), "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(serverKey))
+
+	return transport.TLSInfo{
+		CertFile:      filepath.Join(etcdDir, kubeadmconstants.EtcdPeerCertName),
+		KeyFile:       filepath.Join(etcdDir, kubeadmconstants.EtcdPeerKeyName),
+		TrustedCAFile: filepath.Join(etcdDir, kubeadmconstants.EtcdCACertName),
+	}
+}
+
+func writePEMFile(t *testing.T, path, blockType string, der []byte) {
+	t.Helper()
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		t.Fatalf("couldn't create %q: %v", path, err)
+	}
+	defer f.Close()
+
+	if err := pem.Encode(f, &pem.Block{Type: blockType, Bytes: der}); err != nil {
+		t.Fatalf("couldn't write %q: %v", path, err)
+	}
+}
@@ -0,0 +1,231 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package etcd
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/clientv3"
+
+	"k8s.io/api/core/v1"
+
+	kubeadmapi "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm"
+	kubeadmconstants "k8s.io/kubernetes/cmd/kubeadm/app/constants"
+	"k8s.io/kubernetes/cmd/kubeadm/app/images"
+	kubeadmutil "k8s.io/kubernetes/cmd/kubeadm/app/util"
+	staticpodutil "k8s.io/kubernetes/cmd/kubeadm/app/util/staticpod"
+)
+
+// etcdClientTimeout is the timeout used for short-lived etcd client operations performed by kubeadm.
+const etcdClientTimeout = 30 * time.Second
+
+// CreateLocalEtcdStaticPodManifestFile will write local etcd static pod manifest file.
+func CreateLocalEtcdStaticPodManifestFile(manifestDir string, cfg *kubeadmapi.MasterConfiguration) error {
+	if cfg.Etcd.External != nil {
+		// An externally managed etcd cluster has no static pod for kubeadm to
+		// write; ValidateExternalEtcd is the external-etcd equivalent of the
+		// checks this function does for a local member.
+		fmt.Println("[etcd] External etcd mode in use; skipping local etcd static Pod manifest generation")
+		return nil
+	}
+
+	if cfg.Etcd.Local == nil {
+		return fmt.Errorf("etcd static pod manifest cannot be generated without a Local or External etcd configuration")
+	}
+
+	// When joining an already-running stacked cluster, make sure every existing
+	// member agrees on membership and is reachable before we let the kubelet
+	// start a new member against it; this is what catches the split-brain/stale
+	// member cases a plain MemberAdd wouldn't.
+	if isHAEtcd(cfg.Etcd.Local) && cfg.Etcd.Local.InitialClusterState == "existing" {
+		if err := CheckLocalEtcdClusterStatus(cfg); err != nil {
+			return fmt.Errorf("etcd cluster is not healthy enough to join a new member: %v", err)
+		}
+	}
+
+	// gets etcd StaticPodSpec, actualized for the current MasterConfiguration
+	spec := GetEtcdPodSpec(cfg)
+	// writes etcd StaticPod to disk
+	if err := staticpodutil.WriteStaticPodToDisk(kubeadmconstants.Etcd, manifestDir, spec); err != nil {
+		return err
+	}
+
+	fmt.Printf("[etcd] Wrote Static Pod manifest for a local etcd member to %q\n", kubeadmconstants.GetStaticPodFilepath(kubeadmconstants.Etcd, manifestDir))
+	return nil
+}
+
+// GetEtcdPodSpec returns the Spec for the etcd Pod. It assumes a Local etcd
+// configuration is set; callers driving an external etcd cluster must not
+// call this and should rely on ValidateExternalEtcd instead.
+func GetEtcdPodSpec(cfg *kubeadmapi.MasterConfiguration) v1.Pod {
+	if cfg.Etcd.Local == nil {
+		panic("GetEtcdPodSpec called without a Local etcd configuration")
+	}
+
+	pathType := v1.HostPathDirectoryOrCreate
+	etcdMounts := map[string]v1.Volume{
+		"etcd-data":  staticpodutil.NewVolume("etcd-data", cfg.Etcd.Local.DataDir, &pathType),
+		"etcd-certs": staticpodutil.NewVolume("etcd-certs", cfg.CertificatesDir+"/etcd", &pathType),
+	}
+	return staticpodutil.ComponentPod(
+		v1.Container{
+			Name:            kubeadmconstants.Etcd,
+			Command:         getEtcdCommand(cfg),
+			Image:           images.GetCoreImage(kubeadmconstants.Etcd, cfg.ImageRepository, cfg.UnifiedControlPlaneImage, cfg.Etcd.Local.Image),
+			ImagePullPolicy: v1.PullIfNotPresent,
+			VolumeMounts: []v1.VolumeMount{
+				staticpodutil.NewVolumeMount("etcd-data", cfg.Etcd.Local.DataDir, false),
+				staticpodutil.NewVolumeMount("etcd-certs", cfg.CertificatesDir+"/etcd", false),
+			},
+			LivenessProbe: staticpodutil.ComponentProbe(2379, "/health", v1.URISchemeHTTP),
+		},
+		etcdMounts,
+	)
+}
+
+// isHAEtcd returns true if the LocalEtcd configuration describes a member of a
+// multi-member stacked cluster, i.e. it carries an explicit name and initial
+// cluster membership list, as opposed to the legacy single-node localhost setup.
+func isHAEtcd(local *kubeadmapi.LocalEtcd) bool {
+	return local.Name != "" && len(local.InitialCluster) > 0
+}
+
+// initialClusterState returns the --initial-cluster-state value for the given
+// LocalEtcd configuration, defaulting to "new" for a cluster being bootstrapped
+// for the first time.
+func initialClusterState(local *kubeadmapi.LocalEtcd) string {
+	if local.InitialClusterState == "" {
+		return "new"
+	}
+	return local.InitialClusterState
+}
+
+// advertiseAddress returns the host the local etcd member should bind and
+// advertise its peer/client URLs on, derived from the member's own entry in
+// AdvertisePeerURLs. Falls back to loopback for the legacy single-node setup.
+func advertiseAddress(local *kubeadmapi.LocalEtcd) (string, error) {
+	if len(local.AdvertisePeerURLs) == 0 {
+		return "127.0.0.1", nil
+	}
+	u, err := url.Parse(local.AdvertisePeerURLs[0])
+	if err != nil {
+		return "", fmt.Errorf("could not parse etcd advertise peer URL %q: %v", local.AdvertisePeerURLs[0], err)
+	}
+	return u.Hostname(), nil
+}
+
+// getEtcdCommand populates the command to run etcd on a given node
+func getEtcdCommand(cfg *kubeadmapi.MasterConfiguration) []string {
+	defaultArguments := map[string]string{
+		"listen-client-urls":    "https://127.0.0.1:2379",
+		"advertise-client-urls": "https://127.0.0.1:2379",
+		"data-dir":              cfg.Etcd.Local.DataDir,
+		"cert-file":             kubeadmconstants.EtcdServerCertName,
+		"key-file":              kubeadmconstants.EtcdServerKeyName,
+		"trusted-ca-file":       kubeadmconstants.EtcdCACertName,
+		"client-cert-auth":      "true",
+		"peer-cert-file":        kubeadmconstants.EtcdPeerCertName,
+		"peer-key-file":         kubeadmconstants.EtcdPeerKeyName,
+		"peer-trusted-ca-file":  kubeadmconstants.EtcdCACertName,
+		"snapshot-count":        "10000",
+		"peer-client-cert-auth": "true",
+	}
+
+	if isHAEtcd(cfg.Etcd.Local) {
+		if addr, err := advertiseAddress(cfg.Etcd.Local); err == nil {
+			defaultArguments["listen-peer-urls"] = fmt.Sprintf("https://%s:2380", addr)
+			defaultArguments["listen-client-urls"] = fmt.Sprintf("https://%s:2379", addr)
+			defaultArguments["advertise-client-urls"] = fmt.Sprintf("https://%s:2379", addr)
+		}
+		defaultArguments["name"] = cfg.Etcd.Local.Name
+		defaultArguments["initial-advertise-peer-urls"] = strings.Join(cfg.Etcd.Local.AdvertisePeerURLs, ",")
+		defaultArguments["initial-cluster"] = strings.Join(cfg.Etcd.Local.InitialCluster, ",")
+		defaultArguments["initial-cluster-state"] = initialClusterState(cfg.Etcd.Local)
+	}
+
+	command := []string{"etcd"}
+	command = append(command, kubeadmutil.BuildArgumentListFromMap(defaultArguments, cfg.Etcd.Local.ExtraArgs)...)
+	return command
+}
+
+// newEtcdClient returns a clientv3 client dialed against the given endpoints, using
+// the peer cert/key/ca kubeadm places in CertificatesDir/etcd.
+func newEtcdClient(cfg *kubeadmapi.MasterConfiguration, endpoints []string) (*clientv3.Client, error) {
+	tlsInfo := transportTLSInfo(cfg)
+	tlsConfig, err := tlsInfo.ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't load etcd peer TLS material: %v", err)
+	}
+
+	return clientv3.New(clientv3.Config{
+		Endpoints:   endpoints,
+		DialTimeout: etcdClientTimeout,
+		TLS:         tlsConfig,
+	})
+}
+
+// JoinLocalEtcdMember registers this node's etcd instance as a new member of an
+// already running stacked etcd cluster by calling MemberAdd against one of the
+// existingEndpoints, so that the member can safely start with
+// --initial-cluster-state=existing afterwards. It returns the InitialCluster
+// list (name=peerURL entries for every member, including the new one) that the
+// caller should set on cfg.Etcd.Local before writing the static pod manifest.
+func JoinLocalEtcdMember(cfg *kubeadmapi.MasterConfiguration, existingEndpoints []string) ([]string, error) {
+	if len(cfg.Etcd.Local.AdvertisePeerURLs) == 0 {
+		return nil, fmt.Errorf("cannot join etcd cluster: no AdvertisePeerURLs set for the local member")
+	}
+
+	cli, err := newEtcdClient(cfg, existingEndpoints)
+	if err != nil {
+		return nil, err
+	}
+	defer cli.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), etcdClientTimeout)
+	defer cancel()
+
+	addResp, err := cli.MemberAdd(ctx, cfg.Etcd.Local.AdvertisePeerURLs)
+	if err != nil {
+		return nil, fmt.Errorf("could not add %q as a new etcd member: %v", cfg.Etcd.Local.Name, err)
+	}
+
+	listResp, err := cli.MemberList(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("joined as member %x but could not list the resulting cluster membership: %v", addResp.Member.ID, err)
+	}
+
+	initialCluster := make([]string, 0, len(listResp.Members))
+	for _, member := range listResp.Members {
+		name := member.Name
+		if member.ID == addResp.Member.ID {
+			// the newly added member doesn't have a name yet in MemberList until it
+			// starts up, so use the name kubeadm is about to start it with.
+			name = cfg.Etcd.Local.Name
+		}
+		if len(member.PeerURLs) == 0 {
+			continue
+		}
+		initialCluster = append(initialCluster, fmt.Sprintf("%s=%s", name, member.PeerURLs[0]))
+	}
+
+	cfg.Etcd.Local.InitialClusterState = "existing"
+	return initialCluster, nil
+}
@@ -153,6 +153,71 @@ func TestGetEtcdCommand(t *testing.T) {
 				"--peer-client-cert-auth=true",
 			},
 		},
+		{
+			cfg: &kubeadmapi.MasterConfiguration{
+				Etcd: kubeadmapi.Etcd{
+					Local: &kubeadmapi.LocalEtcd{
+						DataDir:           "/var/lib/etcd",
+						Name:              "infra1",
+						AdvertisePeerURLs: []string{"https://10.0.1.10:2380"},
+						InitialCluster:    []string{"infra1=https://10.0.1.10:2380", "infra2=https://10.0.1.11:2380"},
+					},
+				},
+			},
+			expected: []string{
+				"etcd",
+				"--listen-peer-urls=https://10.0.1.10:2380",
+				"--listen-client-urls=https://10.0.1.10:2379",
+				"--advertise-client-urls=https://10.0.1.10:2379",
+				"--data-dir=/var/lib/etcd",
+				"--cert-file=" + kubeadmconstants.EtcdServerCertName,
+				"--key-file=" + kubeadmconstants.EtcdServerKeyName,
+				"--trusted-ca-file=" + kubeadmconstants.EtcdCACertName,
+				"--client-cert-auth=true",
+				"--peer-cert-file=" + kubeadmconstants.EtcdPeerCertName,
+				"--peer-key-file=" + kubeadmconstants.EtcdPeerKeyName,
+				"--peer-trusted-ca-file=" + kubeadmconstants.EtcdCACertName,
+				"--snapshot-count=10000",
+				"--peer-client-cert-auth=true",
+				"--name=infra1",
+				"--initial-advertise-peer-urls=https://10.0.1.10:2380",
+				"--initial-cluster=infra1=https://10.0.1.10:2380,infra2=https://10.0.1.11:2380",
+				"--initial-cluster-state=new",
+			},
+		},
+		{
+			cfg: &kubeadmapi.MasterConfiguration{
+				Etcd: kubeadmapi.Etcd{
+					Local: &kubeadmapi.LocalEtcd{
+						DataDir:             "/var/lib/etcd",
+						Name:                "infra2",
+						AdvertisePeerURLs:   []string{"https://10.0.1.11:2380"},
+						InitialCluster:      []string{"infra1=https://10.0.1.10:2380", "infra2=https://10.0.1.11:2380"},
+						InitialClusterState: "existing",
+					},
+				},
+			},
+			expected: []string{
+				"etcd",
+				"--listen-peer-urls=https://10.0.1.11:2380",
+				"--listen-client-urls=https://10.0.1.11:2379",
+				"--advertise-client-urls=https://10.0.1.11:2379",
+				"--data-dir=/var/lib/etcd",
+				"--cert-file=" + kubeadmconstants.EtcdServerCertName,
+				"--key-file=" + kubeadmconstants.EtcdServerKeyName,
+				"--trusted-ca-file=" + kubeadmconstants.EtcdCACertName,
+				"--client-cert-auth=true",
+				"--peer-cert-file=" + kubeadmconstants.EtcdPeerCertName,
+				"--peer-key-file=" + kubeadmconstants.EtcdPeerKeyName,
+				"--peer-trusted-ca-file=" + kubeadmconstants.EtcdCACertName,
+				"--snapshot-count=10000",
+				"--peer-client-cert-auth=true",
+				"--name=infra2",
+				"--initial-advertise-peer-urls=https://10.0.1.11:2380",
+				"--initial-cluster=infra1=https://10.0.1.10:2380,infra2=https://10.0.1.11:2380",
+				"--initial-cluster-state=existing",
+			},
+		},
 	}
 
 	for _, rt := range tests {
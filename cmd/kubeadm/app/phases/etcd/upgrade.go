@@ -0,0 +1,141 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package etcd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	kubeadmapi "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm"
+)
+
+const (
+	// upgradeHealthPollInterval is how often UpgradeLocalEtcd polls the restarted
+	// member while waiting for it to rejoin the cluster on the new version.
+	upgradeHealthPollInterval = 2 * time.Second
+	// upgradeHealthTimeout bounds how long UpgradeLocalEtcd waits for the restarted
+	// member to rejoin before rolling the upgrade back.
+	upgradeHealthTimeout = 2 * time.Minute
+)
+
+// UpgradeLocalEtcd performs a rolling upgrade of a single stacked etcd member to
+// newVersion: it snapshots the member's data, rewrites the static pod manifest
+// with the new image tag, waits for the kubelet to restart the Pod and for the
+// member to rejoin the cluster reporting the expected version, and restores the
+// pre-upgrade manifest and data directory if any step fails.
+func UpgradeLocalEtcd(cfg *kubeadmapi.MasterConfiguration, manifestDir, newVersion string) error {
+	if cfg.Etcd.Local == nil {
+		return fmt.Errorf("cannot upgrade etcd: no Local etcd configuration set")
+	}
+
+	backupPath := fmt.Sprintf("/var/lib/etcd-backup-%s", upgradeTimestamp())
+	if err := SnapshotLocalEtcd(cfg, backupPath); err != nil {
+		return fmt.Errorf("couldn't take a pre-upgrade snapshot: %v", err)
+	}
+
+	previousVersion := cfg.KubernetesVersion
+	previousImage := cfg.Etcd.Local.Image
+
+	// cfg.KubernetesVersion itself is not consulted anywhere the etcd container
+	// image is built (images.GetCoreImage only looks at ImageRepository,
+	// UnifiedControlPlaneImage and Etcd.Local.Image), so the image override has
+	// to be updated explicitly for the rewritten manifest to actually point at
+	// newVersion.
+	cfg.KubernetesVersion = newVersion
+	cfg.Etcd.Local.Image = etcdImageForVersion(cfg.ImageRepository, previousImage, newVersion)
+	if err := CreateLocalEtcdStaticPodManifestFile(manifestDir, cfg); err != nil {
+		cfg.KubernetesVersion = previousVersion
+		cfg.Etcd.Local.Image = previousImage
+		return fmt.Errorf("couldn't rewrite the etcd static pod manifest for the upgrade: %v", err)
+	}
+
+	if err := waitForMemberRejoinAtVersion(cfg, newVersion); err != nil {
+		fmt.Printf("[etcd] Upgrade to %s failed, rolling back: %v\n", newVersion, err)
+
+		cfg.KubernetesVersion = previousVersion
+		cfg.Etcd.Local.Image = previousImage
+		if restoreErr := RestoreLocalEtcdFromSnapshot(cfg, manifestDir, backupPath); restoreErr != nil {
+			return fmt.Errorf("upgrade failed (%v) and automatic rollback also failed: %v", err, restoreErr)
+		}
+
+		return fmt.Errorf("upgrade to %s failed and was rolled back to %s: %v", newVersion, previousVersion, err)
+	}
+
+	fmt.Printf("[etcd] Upgraded local etcd member %q to %s\n", cfg.Etcd.Local.Name, newVersion)
+	return nil
+}
+
+// waitForMemberRejoinAtVersion polls the local member's own client-API
+// endpoint health and Status().Version until it reports healthy and running
+// newVersion, or upgradeHealthTimeout elapses. It dials the member being
+// upgraded specifically, rather than any other member of the cluster, since
+// it's that member's own version that needs to change.
+func waitForMemberRejoinAtVersion(cfg *kubeadmapi.MasterConfiguration, newVersion string) error {
+	endpoint := defaultSnapshotEndpoint
+	if len(cfg.Etcd.Local.AdvertisePeerURLs) > 0 {
+		if clientURL, err := clientURLFromPeerURL(cfg.Etcd.Local.AdvertisePeerURLs[0]); err == nil {
+			endpoint = clientURL
+		}
+	}
+	endpoints := []string{endpoint}
+
+	return wait.PollImmediate(upgradeHealthPollInterval, upgradeHealthTimeout, func() (bool, error) {
+		cli, err := newEtcdClient(cfg, endpoints)
+		if err != nil {
+			return false, nil
+		}
+		defer cli.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), etcdClientTimeout)
+		defer cancel()
+
+		if _, err := cli.Get(ctx, "/health"); err != nil {
+			return false, nil
+		}
+
+		status, err := cli.Status(ctx, endpoint)
+		if err != nil {
+			return false, nil
+		}
+
+		return status.Version == newVersion, nil
+	})
+}
+
+// etcdImageForVersion returns the etcd container image kubeadm should set as
+// cfg.Etcd.Local.Image to pin GetEtcdPodSpec to newVersion: it keeps the
+// repository portion of previousImage (if one was already configured) or
+// falls back to repo/etcd, and replaces the tag with newVersion.
+func etcdImageForVersion(repo, previousImage, newVersion string) string {
+	base := previousImage
+	if base == "" {
+		if repo == "" {
+			repo = "k8s.gcr.io"
+		}
+		base = repo + "/etcd"
+	} else if idx := strings.LastIndex(base, ":"); idx > strings.LastIndex(base, "/") {
+		base = base[:idx]
+	}
+	return fmt.Sprintf("%s:%s", base, newVersion)
+}
+
+func upgradeTimestamp() string {
+	return time.Now().Format("20060102150405")
+}
@@ -0,0 +1,229 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package etcd
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/clientv3"
+	"go.etcd.io/etcd/embed"
+	"go.etcd.io/etcd/integration"
+	"go.etcd.io/etcd/pkg/transport"
+
+	kubeadmapi "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm"
+)
+
+func TestUpgradeLocalEtcdRequiresLocalConfig(t *testing.T) {
+	cfg := &kubeadmapi.MasterConfiguration{}
+	if err := UpgradeLocalEtcd(cfg, "/tmp/manifests", "3.4.0"); err == nil {
+		t.Error("expected UpgradeLocalEtcd to fail without a Local etcd configuration, got nil error")
+	}
+}
+
+func TestEtcdImageForVersion(t *testing.T) {
+	var tests = []struct {
+		name          string
+		repo          string
+		previousImage string
+		newVersion    string
+		expected      string
+	}{
+		{
+			name:          "no previous override falls back to repo/etcd",
+			repo:          "k8s.gcr.io",
+			previousImage: "",
+			newVersion:    "3.4.3-0",
+			expected:      "k8s.gcr.io/etcd:3.4.3-0",
+		},
+		{
+			name:          "no previous override and no repo falls back to k8s.gcr.io",
+			repo:          "",
+			previousImage: "",
+			newVersion:    "3.4.3-0",
+			expected:      "k8s.gcr.io/etcd:3.4.3-0",
+		},
+		{
+			name:          "keeps a custom previous registry, swaps the tag",
+			repo:          "k8s.gcr.io",
+			previousImage: "my.registry.example.com/etcd:3.3.10",
+			newVersion:    "3.4.3-0",
+			expected:      "my.registry.example.com/etcd:3.4.3-0",
+		},
+		{
+			name:          "tolerates a previous image with no tag",
+			repo:          "k8s.gcr.io",
+			previousImage: "my.registry.example.com/etcd",
+			newVersion:    "3.4.3-0",
+			expected:      "my.registry.example.com/etcd:3.4.3-0",
+		},
+	}
+
+	for _, rt := range tests {
+		t.Run(rt.name, func(t *testing.T) {
+			actual := etcdImageForVersion(rt.repo, rt.previousImage, rt.newVersion)
+			if actual != rt.expected {
+				t.Errorf("etcdImageForVersion returned %q, expected %q", actual, rt.expected)
+			}
+		})
+	}
+}
+
+// TestUpgradeLocalEtcdRollsBackOnFailure runs UpgradeLocalEtcd against a real,
+// single-member embedded etcd server bound to the same loopback addresses
+// kubeadm defaults a non-HA LocalEtcd member to. Nothing in the test actually
+// restarts that server on the "new" version, so waitForMemberRejoinAtVersion
+// can never succeed - exercising the automatic restore-from-snapshot rollback
+// path, and that cfg is reverted to its pre-upgrade KubernetesVersion/Image.
+func TestUpgradeLocalEtcdRollsBackOnFailure(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping live etcd upgrade/rollback test in short mode")
+	}
+	integration.BeforeTestExternal(t)
+
+	tmpdir, err := os.MkdirTemp("", "kubeadm-etcd-upgrade-rollback-test")
+	if err != nil {
+		t.Fatalf("couldn't create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	tlsInfo := writeTestEtcdCerts(t, tmpdir)
+	dataDir := filepath.Join(tmpdir, "etcd-data")
+	manifestDir := filepath.Join(tmpdir, "manifests")
+
+	e := startTestEmbeddedEtcd(t, dataDir, tlsInfo)
+	defer e.Close()
+
+	previousVersion := "v1.14.0"
+	previousImage := "k8s.gcr.io/etcd:3.3.10"
+	cfg := &kubeadmapi.MasterConfiguration{
+		CertificatesDir:   tmpdir,
+		KubernetesVersion: previousVersion,
+		Etcd: kubeadmapi.Etcd{
+			Local: &kubeadmapi.LocalEtcd{
+				Name:    "default",
+				DataDir: dataDir,
+				Image:   previousImage,
+			},
+		},
+	}
+
+	if err := UpgradeLocalEtcd(cfg, manifestDir, "99.99.99"); err == nil {
+		t.Fatal("expected UpgradeLocalEtcd to fail when the member never reports the new version")
+	}
+
+	if cfg.KubernetesVersion != previousVersion {
+		t.Errorf("expected KubernetesVersion to be rolled back to %q, got %q", previousVersion, cfg.KubernetesVersion)
+	}
+	if cfg.Etcd.Local.Image != previousImage {
+		t.Errorf("expected Image to be rolled back to %q, got %q", previousImage, cfg.Etcd.Local.Image)
+	}
+}
+
+// startTestEmbeddedEtcd starts a single-member etcd server listening on
+// 127.0.0.1:2379/2380 - the loopback addresses advertiseAddress falls back to
+// for a LocalEtcd with no AdvertisePeerURLs set - so the code under test dials
+// exactly the endpoint a real kubeadm-managed non-HA member would use.
+func startTestEmbeddedEtcd(t *testing.T, dataDir string, tlsInfo transport.TLSInfo) *embed.Etcd {
+	t.Helper()
+
+	clientURL := url.URL{Scheme: "https", Host: "127.0.0.1:2379"}
+	peerURL := url.URL{Scheme: "https", Host: "127.0.0.1:2380"}
+
+	cfg := embed.NewConfig()
+	cfg.Name = "default"
+	cfg.Dir = dataDir
+	cfg.LCUrls = []url.URL{clientURL}
+	cfg.ACUrls = []url.URL{clientURL}
+	cfg.LPUrls = []url.URL{peerURL}
+	cfg.APUrls = []url.URL{peerURL}
+	cfg.InitialCluster = "default=" + peerURL.String()
+	cfg.ClientTLSInfo = tlsInfo
+	cfg.PeerTLSInfo = tlsInfo
+
+	e, err := embed.StartEtcd(cfg)
+	if err != nil {
+		t.Fatalf("couldn't start embedded etcd: %v", err)
+	}
+
+	select {
+	case <-e.Server.ReadyNotify():
+	case <-time.After(30 * time.Second):
+		e.Close()
+		t.Fatal("embedded etcd took too long to become ready")
+	}
+
+	return e
+}
+
+// TestWaitForMemberRejoinAtVersion exercises the version-detection poll loop
+// against an embedded single-member etcd cluster: it should report success once
+// Status().Version matches, and time out if the version never matches.
+func TestWaitForMemberRejoinAtVersion(t *testing.T) {
+	integration.BeforeTestExternal(t)
+
+	clus := integration.NewClusterV3(t, &integration.ClusterConfig{Size: 1})
+	defer clus.Terminate(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), etcdClientTimeout)
+	defer cancel()
+	status, err := clus.Client(0).Status(ctx, clus.Members[0].GRPCAddr())
+	if err != nil {
+		t.Fatalf("couldn't read cluster status: %v", err)
+	}
+
+	endpoints := []string{clus.Members[0].GRPCAddr()}
+
+	if err := waitForVersionForTest(endpoints, status.Version, 5*time.Second); err != nil {
+		t.Errorf("expected the poll to succeed once the version matches: %v", err)
+	}
+
+	if err := waitForVersionForTest(endpoints, "not-a-real-version", 2*time.Second); err == nil {
+		t.Error("expected the poll to time out for a version that never matches")
+	}
+}
+
+// waitForVersionForTest exercises the same Get("/health") + Status().Version
+// poll waitForMemberRejoinAtVersion performs, but against a plain insecure
+// clientv3 client (the embedded test cluster carries no kubeadm-issued certs)
+// and with a caller-supplied timeout so the test doesn't wait out the full
+// production upgradeHealthTimeout.
+func waitForVersionForTest(endpoints []string, newVersion string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		cli, err := clientv3.New(clientv3.Config{Endpoints: endpoints, DialTimeout: etcdClientTimeout})
+		if err == nil {
+			ctx, cancel := context.WithTimeout(context.Background(), etcdClientTimeout)
+			if _, err := cli.Get(ctx, "/health"); err == nil {
+				if status, err := cli.Status(ctx, endpoints[0]); err == nil && status.Version == newVersion {
+					cancel()
+					cli.Close()
+					return nil
+				}
+			}
+			cancel()
+			cli.Close()
+		}
+		time.Sleep(upgradeHealthPollInterval)
+	}
+
+	return context.DeadlineExceeded
+}
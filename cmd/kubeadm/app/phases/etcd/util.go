@@ -0,0 +1,37 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package etcd
+
+import (
+	"path/filepath"
+
+	"go.etcd.io/etcd/pkg/transport"
+
+	kubeadmapi "k8s.io/kubernetes/cmd/kubeadm/app/apis/kubeadm"
+	kubeadmconstants "k8s.io/kubernetes/cmd/kubeadm/app/constants"
+)
+
+// transportTLSInfo builds the etcd transport.TLSInfo kubeadm uses to dial a local,
+// kubeadm-managed etcd cluster: the peer cert/key pair and the shared etcd CA.
+func transportTLSInfo(cfg *kubeadmapi.MasterConfiguration) transport.TLSInfo {
+	etcdCertsDir := filepath.Join(cfg.CertificatesDir, "etcd")
+	return transport.TLSInfo{
+		CertFile:      filepath.Join(etcdCertsDir, kubeadmconstants.EtcdPeerCertName),
+		KeyFile:       filepath.Join(etcdCertsDir, kubeadmconstants.EtcdPeerKeyName),
+		TrustedCAFile: filepath.Join(etcdCertsDir, kubeadmconstants.EtcdCACertName),
+	}
+}